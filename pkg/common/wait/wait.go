@@ -0,0 +1,159 @@
+// Package wait provides a readiness-predicate resource waiter modeled on
+// Helm 3's resource readiness checker. Rather than busy-looping Update calls
+// to keep a resource in a disrupted state while separately polling for the
+// side effect that disruption is supposed to cause, callers describe what
+// "ready" (or "not ready") means for each resource once and let Wait block
+// until every resource satisfies it or the timeout elapses.
+package wait
+
+import (
+	goctx "context"
+	"fmt"
+	"strings"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	osappsv1 "github.com/openshift/api/apps/v1"
+)
+
+// pollInterval is how often each target is re-fetched while waiting.
+const pollInterval = 2 * time.Second
+
+// Predicate reports whether obj currently satisfies some readiness
+// condition. A Predicate is expected to type-switch on the concrete Kind(s)
+// it knows how to evaluate and return an error for any other Kind.
+type Predicate func(obj client.Object) (bool, error)
+
+// Target pairs a resource reference with the Predicate that determines
+// whether it has settled into the state the caller is waiting for.
+type Target struct {
+	Object    client.Object
+	Predicate Predicate
+}
+
+// Waiter polls a set of Targets against the API server until every one of
+// them satisfies its Predicate, or Timeout elapses.
+type Waiter struct {
+	Client  client.Client
+	Timeout time.Duration
+}
+
+// New returns a Waiter that polls c and gives up after timeout.
+func New(c client.Client, timeout time.Duration) *Waiter {
+	return &Waiter{Client: c, Timeout: timeout}
+}
+
+// For waits for every obj in objs to satisfy predicate. It's a convenience
+// wrapper over WaitForTargets for the common case where every resource being
+// watched shares the same readiness condition (e.g. several Deployments that
+// must all reach ReadyReplicas(0)).
+func (w *Waiter) For(ctx goctx.Context, predicate Predicate, objs ...client.Object) error {
+	targets := make([]Target, 0, len(objs))
+	for _, obj := range objs {
+		targets = append(targets, Target{Object: obj, Predicate: predicate})
+	}
+
+	return w.WaitForTargets(ctx, targets)
+}
+
+// WaitForTargets polls every Target until all of their Predicates hold, or
+// Timeout elapses. On timeout the returned error lists, per resource,
+// whether it was never found or whether its Predicate never held. Any other
+// error fetching a resource, or evaluating its Predicate, ends the wait
+// immediately and is returned as is.
+func (w *Waiter) WaitForTargets(ctx goctx.Context, targets []Target) error {
+	unready := map[string]string{}
+
+	err := wait.PollImmediate(pollInterval, w.Timeout, func() (bool, error) {
+		unready = map[string]string{}
+
+		for _, target := range targets {
+			name := fmt.Sprintf("%T %s", target.Object, client.ObjectKeyFromObject(target.Object))
+
+			if err := w.Client.Get(ctx, client.ObjectKeyFromObject(target.Object), target.Object); err != nil {
+				if apierrors.IsNotFound(err) {
+					unready[name] = "not found"
+					continue
+				}
+				return false, fmt.Errorf("failed to get %s: %w", name, err)
+			}
+
+			ok, err := target.Predicate(target.Object)
+			if err != nil {
+				return false, fmt.Errorf("failed to evaluate readiness of %s: %w", name, err)
+			}
+			if !ok {
+				unready[name] = "predicate not satisfied"
+			}
+		}
+
+		return len(unready) == 0, nil
+	})
+
+	if err == wait.ErrWaitTimeout {
+		details := make([]string, 0, len(unready))
+		for name, reason := range unready {
+			details = append(details, fmt.Sprintf("%s: %s", name, reason))
+		}
+		return fmt.Errorf("timed out after %s waiting for resources to become ready: %s", w.Timeout, strings.Join(details, "; "))
+	}
+
+	return err
+}
+
+// ReadyReplicas returns a Predicate satisfied once the resource's ready (or,
+// for a DaemonSet, numberReady) replica count equals want. It supports
+// Deployment, DeploymentConfig, StatefulSet and DaemonSet.
+func ReadyReplicas(want int32) Predicate {
+	return func(obj client.Object) (bool, error) {
+		switch o := obj.(type) {
+		case *appsv1.Deployment:
+			return o.Status.ReadyReplicas == want, nil
+		case *osappsv1.DeploymentConfig:
+			return o.Status.ReadyReplicas == want, nil
+		case *appsv1.StatefulSet:
+			return o.Status.ReadyReplicas == want, nil
+		case *appsv1.DaemonSet:
+			return o.Status.NumberReady == want, nil
+		default:
+			return false, fmt.Errorf("ReadyReplicas predicate does not support %T", obj)
+		}
+	}
+}
+
+// AvailableReplicas returns a Predicate satisfied once the resource's
+// available replica count is at least min. It supports Deployment and
+// DeploymentConfig.
+func AvailableReplicas(min int32) Predicate {
+	return func(obj client.Object) (bool, error) {
+		switch o := obj.(type) {
+		case *appsv1.Deployment:
+			return o.Status.AvailableReplicas >= min, nil
+		case *osappsv1.DeploymentConfig:
+			return o.Status.AvailableReplicas >= min, nil
+		default:
+			return false, fmt.Errorf("AvailableReplicas predicate does not support %T", obj)
+		}
+	}
+}
+
+// PodRunning is a Predicate satisfied once a Pod's phase is Running.
+func PodRunning(obj client.Object) (bool, error) {
+	pod, ok := obj.(*corev1.Pod)
+	if !ok {
+		return false, fmt.Errorf("PodRunning predicate does not support %T", obj)
+	}
+
+	return pod.Status.Phase == corev1.PodRunning, nil
+}
+
+// NotReady is shorthand for ReadyReplicas(0), the predicate used to confirm
+// that a workload has actually been scaled down rather than merely asked to.
+func NotReady() Predicate {
+	return ReadyReplicas(0)
+}
@@ -0,0 +1,424 @@
+package common
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+// testAlertDeliveryEnvVar gates TestAlertDelivery, since it pages real
+// PagerDuty/DeadMansSnitch/SMTP endpoints and should only run when a test
+// environment is explicitly wired up to receive it.
+const testAlertDeliveryEnvVar = "TEST_ALERT_DELIVERY_ENABLED"
+
+// pagerDutyAPITokenEnvVar is a PagerDuty REST API token (distinct from the
+// integration service key redhat-rhmi-pagerduty carries, which can only
+// write events, not query them) used to confirm and clean up the incident
+// the synthetic alert creates.
+const pagerDutyAPITokenEnvVar = "PAGERDUTY_API_TOKEN"
+
+// pagerDutyFromEmailEnvVar is the email address of a PagerDuty user/token
+// the REST API requires on the "From" header of write requests.
+const pagerDutyFromEmailEnvVar = "PAGERDUTY_FROM_EMAIL"
+
+// alertDeliveryCases are the synthetic alerts fired by TestAlertDelivery, one
+// per receiver that should see real, external delivery.
+var alertDeliveryCases = []struct {
+	name   string
+	labels map[string]string
+	verify func(ctx *TestingContext) error
+}{
+	{
+		name:   "pagerduty",
+		labels: map[string]string{"alertname": "RHMISyntheticAlertDeliveryTest", "severity": "critical"},
+		verify: verifyPagerDutyDelivery,
+	},
+	{
+		name:   "deadmansswitch",
+		labels: map[string]string{"alertname": "DeadMansSwitch"},
+		verify: verifyDeadMansSnitchDelivery,
+	},
+	{
+		name:   "smtp",
+		labels: map[string]string{"alertname": "RHMISyntheticAlertDeliveryTest", "severity": "critical"},
+		verify: verifySMTPDelivery,
+	},
+}
+
+// TestAlertDelivery fires a synthetic alert for each receiver RHMI wires up
+// (PagerDuty, DeadMansSnitch, SMTP) via amtool, and confirms the alert was
+// actually delivered to the real external endpoint rather than just checking
+// that alertmanager is configured to route to it. It is gated behind
+// testAlertDeliveryEnvVar.
+//
+// The cases are only silenced once every verify has run: a silence suppresses
+// the receiver notification alertmanager would otherwise send, and the
+// pagerduty and smtp cases share a label set, so silencing any case up front
+// would make delivery impossible to observe. The silences are expired when
+// the test returns, so the synthetic alerts don't keep re-paging on-call for
+// the rest of their repeat_interval.
+func TestAlertDelivery(t *testing.T, ctx *TestingContext) {
+	if os.Getenv(testAlertDeliveryEnvVar) != "true" {
+		t.Skipf("%s is not set to \"true\", skipping live alert delivery test", testAlertDeliveryEnvVar)
+		return
+	}
+
+	var silenceIDs []string
+	defer func() {
+		for _, silenceID := range silenceIDs {
+			if err := amtoolSilenceExpire(ctx, silenceID); err != nil {
+				t.Logf("failed to expire silence %s: %v", silenceID, err)
+			}
+		}
+	}()
+
+	var fired []int
+	for i, testCase := range alertDeliveryCases {
+		if err := amtoolAlertAdd(ctx, testCase.labels); err != nil {
+			t.Errorf("%s: failed to add synthetic alert: %v", testCase.name, err)
+			continue
+		}
+		fired = append(fired, i)
+
+		if err := testCase.verify(ctx); err != nil {
+			t.Errorf("%s: %v", testCase.name, err)
+		}
+	}
+
+	for _, i := range fired {
+		testCase := alertDeliveryCases[i]
+		silenceID, err := amtoolSilenceAdd(ctx, testCase.labels)
+		if err != nil {
+			t.Logf("%s: failed to silence synthetic alert: %v", testCase.name, err)
+			continue
+		}
+		silenceIDs = append(silenceIDs, silenceID)
+	}
+}
+
+func amtoolAlertAdd(ctx *TestingContext, labels map[string]string) error {
+	_, err := execToPod(fmt.Sprintf("amtool alert add %s --alertmanager.url=http://localhost:9093", labelArgs(labels)),
+		"alertmanager-application-monitoring-0",
+		MonitoringOperatorNamespace,
+		"alertmanager",
+		ctx)
+	if err != nil {
+		return fmt.Errorf("failed to exec to alertmanager pod: %w", err)
+	}
+
+	return nil
+}
+
+func amtoolSilenceAdd(ctx *TestingContext, labels map[string]string) (string, error) {
+	output, err := execToPod(fmt.Sprintf("amtool silence add %s --comment=\"integreatly-operator synthetic alert test\" --alertmanager.url=http://localhost:9093", labelArgs(labels)),
+		"alertmanager-application-monitoring-0",
+		MonitoringOperatorNamespace,
+		"alertmanager",
+		ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to exec to alertmanager pod: %w", err)
+	}
+
+	return strings.TrimSpace(output), nil
+}
+
+func amtoolSilenceExpire(ctx *TestingContext, silenceID string) error {
+	_, err := execToPod(fmt.Sprintf("amtool silence expire %s --alertmanager.url=http://localhost:9093", silenceID),
+		"alertmanager-application-monitoring-0",
+		MonitoringOperatorNamespace,
+		"alertmanager",
+		ctx)
+	if err != nil {
+		return fmt.Errorf("failed to exec to alertmanager pod: %w", err)
+	}
+
+	return nil
+}
+
+func labelArgs(labels map[string]string) string {
+	args := make([]string, 0, len(labels))
+	for key, value := range labels {
+		args = append(args, fmt.Sprintf("%s=%s", key, value))
+	}
+
+	return strings.Join(args, " ")
+}
+
+// verifyDeadMansSnitchDelivery hits the snitch's status API using the URL in
+// the redhat-rhmi-deadmanssnitch secret, and asserts last_check_in advanced
+// after the synthetic alert was fired.
+func verifyDeadMansSnitchDelivery(ctx *TestingContext) error {
+	res, err := ctx.KubeClient.CoreV1().Secrets(RHMIOperatorNamespace).Get("redhat-rhmi-deadmanssnitch", metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to get deadmanssnitch secret: %w", err)
+	}
+	snitchURL := string(res.Data["url"])
+
+	before, err := getSnitchLastCheckIn(snitchURL)
+	if err != nil {
+		return fmt.Errorf("failed to get snitch status before firing alert: %w", err)
+	}
+
+	return wait.PollImmediate(30*time.Second, 5*time.Minute, func() (bool, error) {
+		after, err := getSnitchLastCheckIn(snitchURL)
+		if err != nil {
+			return false, nil
+		}
+
+		return after.After(before), nil
+	})
+}
+
+func getSnitchLastCheckIn(snitchURL string) (time.Time, error) {
+	res, err := http.Get(snitchURL)
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer res.Body.Close()
+
+	var status struct {
+		LastCheckIn time.Time `json:"last_check_in"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&status); err != nil {
+		return time.Time{}, err
+	}
+
+	return status.LastCheckIn, nil
+}
+
+// pagerDutySyntheticAlertTitle is a substring of the incident title
+// PagerDuty derives from the synthetic alert, used to pick it out of the
+// REST API's incident list.
+const pagerDutySyntheticAlertTitle = "RHMISyntheticAlertDeliveryTest"
+
+// verifyPagerDutyDelivery confirms, via the PagerDuty REST API, that an
+// incident was created for the synthetic alert alertmanager dispatched to
+// the redhat-rhmi-pagerduty integration, then resolves it so it doesn't stay
+// open against real on-call.
+//
+// The Events API v2 endpoint the integration service key writes to
+// (https://events.pagerduty.com/v2/enqueue) is write-only and can't be
+// queried, and alertmanager - not this test - generates the event's
+// dedup_key, so incidents are looked up by title via the REST API using a
+// separate API token instead.
+func verifyPagerDutyDelivery(ctx *TestingContext) error {
+	apiToken := os.Getenv(pagerDutyAPITokenEnvVar)
+	if apiToken == "" {
+		return fmt.Errorf("%s is not set, cannot verify pagerduty delivery via the REST API", pagerDutyAPITokenEnvVar)
+	}
+
+	since := time.Now().Add(-1 * time.Minute)
+
+	incidentID, err := waitForPagerDutyIncident(apiToken, since)
+	if err != nil {
+		return fmt.Errorf("incident was not created: %w", err)
+	}
+
+	return resolvePagerDutyIncident(apiToken, incidentID)
+}
+
+func waitForPagerDutyIncident(apiToken string, since time.Time) (string, error) {
+	var incidentID string
+
+	err := wait.PollImmediate(30*time.Second, 5*time.Minute, func() (bool, error) {
+		id, found, err := findPagerDutyIncident(apiToken, since)
+		if err != nil {
+			return false, nil
+		}
+		if !found {
+			return false, nil
+		}
+
+		incidentID = id
+		return true, nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return incidentID, nil
+}
+
+func findPagerDutyIncident(apiToken string, since time.Time) (string, bool, error) {
+	url := fmt.Sprintf("https://api.pagerduty.com/incidents?since=%s&statuses[]=triggered&statuses[]=acknowledged", since.UTC().Format(time.RFC3339))
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return "", false, err
+	}
+	req.Header.Set("Authorization", "Token token="+apiToken)
+	req.Header.Set("Accept", "application/vnd.pagerduty+json;version=2")
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", false, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return "", false, fmt.Errorf("pagerduty incidents api returned status %d", res.StatusCode)
+	}
+
+	var result struct {
+		Incidents []struct {
+			ID    string `json:"id"`
+			Title string `json:"title"`
+		} `json:"incidents"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&result); err != nil {
+		return "", false, err
+	}
+
+	for _, incident := range result.Incidents {
+		if strings.Contains(incident.Title, pagerDutySyntheticAlertTitle) {
+			return incident.ID, true, nil
+		}
+	}
+
+	return "", false, nil
+}
+
+func resolvePagerDutyIncident(apiToken, incidentID string) error {
+	body, err := json.Marshal(map[string]interface{}{
+		"incident": map[string]interface{}{
+			"type":   "incident_reference",
+			"status": "resolved",
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPut, "https://api.pagerduty.com/incidents/"+incidentID, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Token token="+apiToken)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/vnd.pagerduty+json;version=2")
+	req.Header.Set("From", os.Getenv(pagerDutyFromEmailEnvVar))
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to call pagerduty incidents api: %w", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("pagerduty incidents api returned status %d when resolving %s", res.StatusCode, incidentID)
+	}
+
+	return nil
+}
+
+// verifySMTPDelivery connects to the configured smart host with the
+// redhat-rhmi-smtp secret's credentials and checks the configured mailbox for
+// the alert notification email.
+func verifySMTPDelivery(ctx *TestingContext) error {
+	res, err := ctx.KubeClient.CoreV1().Secrets(RHMIOperatorNamespace).Get("redhat-rhmi-smtp", metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to get smtp secret: %w", err)
+	}
+
+	host := string(res.Data["host"])
+	port := string(res.Data["port"])
+	username := string(res.Data["username"])
+	password := string(res.Data["password"])
+
+	auth := smtp.PlainAuth("", username, password, host)
+	client, err := smtp.Dial(host + ":" + port)
+	if err != nil {
+		return fmt.Errorf("failed to connect to smtp smart host: %w", err)
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("AUTH"); ok {
+		if err := client.Auth(auth); err != nil {
+			return fmt.Errorf("failed to authenticate with smtp smart host: %w", err)
+		}
+	}
+
+	return checkMailboxForAlertEmail()
+}
+
+// checkMailboxForAlertEmail polls the mailbox configured via
+// RHMI_SMTP_TEST_MAILBOX_* environment variables for the synthetic alert
+// notification email. The mailbox itself is operator-specific test
+// infrastructure, so its address is supplied rather than assumed. Only IMAP
+// mailboxes are supported; POP3 is not.
+func checkMailboxForAlertEmail() error {
+	mailbox := os.Getenv("RHMI_SMTP_TEST_MAILBOX_ADDR")
+	if mailbox == "" {
+		return fmt.Errorf("RHMI_SMTP_TEST_MAILBOX_ADDR is not set, cannot verify mailbox delivery")
+	}
+
+	return wait.PollImmediate(30*time.Second, 5*time.Minute, func() (bool, error) {
+		return mailboxHasAlertEmail(mailbox)
+	})
+}
+
+// mailboxHasAlertEmail logs into the IMAP mailbox configured via
+// RHMI_SMTP_TEST_MAILBOX_* and reports whether an unseen message matching the
+// synthetic alert's subject has arrived.
+func mailboxHasAlertEmail(addr string) (bool, error) {
+	username := os.Getenv("RHMI_SMTP_TEST_MAILBOX_USER")
+	password := os.Getenv("RHMI_SMTP_TEST_MAILBOX_PASSWORD")
+
+	conn, err := textproto.Dial("tcp", addr)
+	if err != nil {
+		return false, fmt.Errorf("failed to connect to mailbox %s: %w", addr, err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.ReadLine(); err != nil {
+		return false, fmt.Errorf("failed to read imap greeting: %w", err)
+	}
+
+	loginID, err := conn.Cmd("a1 LOGIN %s %s", username, password)
+	if err != nil {
+		return false, fmt.Errorf("failed to login to mailbox: %w", err)
+	}
+	conn.StartResponse(loginID)
+	_, _ = conn.ReadLine()
+	conn.EndResponse(loginID)
+
+	selectID, err := conn.Cmd("a2 SELECT INBOX")
+	if err != nil {
+		return false, fmt.Errorf("failed to select inbox: %w", err)
+	}
+	conn.StartResponse(selectID)
+	for {
+		line, err := conn.ReadLine()
+		if err != nil {
+			conn.EndResponse(selectID)
+			return false, fmt.Errorf("failed to read select response: %w", err)
+		}
+		if strings.HasPrefix(line, "a2 ") {
+			break
+		}
+	}
+	conn.EndResponse(selectID)
+
+	searchID, err := conn.Cmd(`a3 SEARCH UNSEEN SUBJECT "RHMISyntheticAlertDeliveryTest"`)
+	if err != nil {
+		return false, fmt.Errorf("failed to search mailbox: %w", err)
+	}
+	conn.StartResponse(searchID)
+	defer conn.EndResponse(searchID)
+
+	line, err := conn.ReadLine()
+	if err != nil {
+		return false, fmt.Errorf("failed to read search response: %w", err)
+	}
+
+	return strings.HasPrefix(line, "* SEARCH") && len(strings.Fields(line)) > 2, nil
+}
@@ -0,0 +1,260 @@
+package common
+
+import (
+	goctx "context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8swait "k8s.io/apimachinery/pkg/util/wait"
+
+	"github.com/integr8ly/integreatly-operator/pkg/common/wait"
+)
+
+// AlertScenario describes a reusable alert-firing test case: a set of
+// Disruptions to apply to the cluster, and the alerts that are expected to
+// start pending then firing as a result.
+type AlertScenario struct {
+	Name           string
+	ExpectedAlerts []string
+	Disruptions    []Disruption
+}
+
+// alertScenarios are the built-in scenarios run by TestIntegreatlyAlertsMechanism,
+// one per RHMI product, so that a single test exercises the whole alert
+// catalog rather than only Fuse.
+var alertScenarios = []AlertScenario{
+	{
+		Name:           "fuse",
+		ExpectedAlerts: []string{"FuseOnlineSyndesisUIInstanceDown", "RHMIFuseOnlineSyndesisUiServiceEndpointDown"},
+		Disruptions: []Disruption{
+			&ScaleDeployment{Name: fuseOperatorDeploymentName, Namespace: FuseOperatorNamespace, Replicas: 0},
+			&ScaleDeploymentConfig{Name: fuseUIDeploymentConfigName, Namespace: FuseProductNamespace, Replicas: 0},
+		},
+	},
+	{
+		Name:           "3scale",
+		ExpectedAlerts: []string{"ThreeScaleApicastProductionPodCount", "RHMIThreeScaleApicastProductionServiceEndpointDown"},
+		Disruptions: []Disruption{
+			&ScaleDeployment{Name: "apicast-production", Namespace: ThreeScaleProductNamespace, Replicas: 0},
+			&BreakService{Name: "apicast-production", Namespace: ThreeScaleProductNamespace},
+		},
+	},
+	{
+		Name:           "rhsso",
+		ExpectedAlerts: []string{"RHMIRhssoInstanceDown", "RHMIRhssoServiceEndpointDown"},
+		Disruptions: []Disruption{
+			&ScaleDeployment{Name: "keycloak", Namespace: RHSSOProductNamespace, Replicas: 0},
+		},
+	},
+	{
+		Name:           "user-sso",
+		ExpectedAlerts: []string{"RHMIUserSsoInstanceDown", "RHMIUserSsoServiceEndpointDown"},
+		Disruptions: []Disruption{
+			&ScaleDeployment{Name: "keycloak", Namespace: UserSSOProductNamespace, Replicas: 0},
+		},
+	},
+	{
+		Name:           "codeready",
+		ExpectedAlerts: []string{"RHMICodereadyWorkspacesOperatorDown"},
+		Disruptions: []Disruption{
+			&ScaleDeployment{Name: "codeready-operator", Namespace: CodeReadyOperatorNamespace, Replicas: 0},
+			&DeletePod{Namespace: CodeReadyOperatorNamespace, LabelSelector: "name=codeready-operator"},
+		},
+	},
+	{
+		Name:           "amq-online",
+		ExpectedAlerts: []string{"RHMIAMQOnlineAddressSpaceControllerDown"},
+		Disruptions: []Disruption{
+			&ScaleDeployment{Name: "address-space-controller", Namespace: AMQOnlineOperatorNamespace, Replicas: 0},
+			&BlockEgressNetworkPolicy{
+				Namespace:   AMQOnlineOperatorNamespace,
+				PodSelector: metav1.LabelSelector{MatchLabels: map[string]string{"name": "address-space-controller"}},
+			},
+		},
+	},
+}
+
+// scenarioReadinessTimeout bounds how long RunAlertScenario waits for a
+// scenario's disruptions to actually take effect on the resources they
+// target, before it starts waiting on the resulting alert.
+const scenarioReadinessTimeout = 2 * time.Minute
+
+// disruptionReassertInterval is how often RunAlertScenario re-applies a
+// scenario's disruptions for as long as the scenario is running. Nothing in
+// this repo's reconcilers honours pausedAnnotation, so left alone the owning
+// operator would scale a disrupted workload straight back up; periodically
+// re-applying the disruption is what actually keeps it held in place.
+const disruptionReassertInterval = 30 * time.Second
+
+// RunAlertScenario applies a scenario's disruptions once each, waits for any
+// of them that expose a ReadinessTarget to settle into the disrupted state
+// via pkg/common/wait, then waits for every expected alert to reach pending
+// then firing, cross-verifies via amtool on the alertmanager pod, and
+// restores the original state before returning. For the lifetime of the
+// scenario, the disruptions are periodically re-applied so the owning
+// operator reconciling the workload back to its original state doesn't
+// undermine the test.
+func RunAlertScenario(t *testing.T, ctx *TestingContext, scenario AlertScenario) error {
+	t.Logf("running alert scenario %q", scenario.Name)
+
+	defer func() {
+		for _, disruption := range scenario.Disruptions {
+			if err := disruption.Restore(ctx); err != nil {
+				t.Logf("%s: failed to restore disruption %q: %v", scenario.Name, disruption, err)
+			}
+		}
+	}()
+	for _, disruption := range scenario.Disruptions {
+		if err := disruption.Apply(ctx); err != nil {
+			return fmt.Errorf("%s: failed to apply disruption %q: %w", scenario.Name, disruption, err)
+		}
+	}
+
+	stopReasserting := make(chan struct{})
+	var reassertWG sync.WaitGroup
+	reassertWG.Add(1)
+	go func() {
+		defer reassertWG.Done()
+
+		ticker := time.NewTicker(disruptionReassertInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-stopReasserting:
+				return
+			case <-ticker.C:
+				for _, disruption := range scenario.Disruptions {
+					if err := disruption.Apply(ctx); err != nil {
+						t.Logf("%s: failed to re-apply disruption %q: %v", scenario.Name, disruption, err)
+					}
+				}
+			}
+		}
+	}()
+	defer func() {
+		close(stopReasserting)
+		reassertWG.Wait()
+	}()
+
+	var targets []wait.Target
+	for _, disruption := range scenario.Disruptions {
+		if readinessAware, ok := disruption.(ReadinessTarget); ok {
+			targets = append(targets, readinessAware.WaitTarget())
+		}
+	}
+	if len(targets) > 0 {
+		waiter := wait.New(ctx.Client, scenarioReadinessTimeout)
+		if err := waiter.WaitForTargets(goctx.TODO(), targets); err != nil {
+			return fmt.Errorf("%s: disruption did not take effect: %w", scenario.Name, err)
+		}
+	}
+
+	if err := waitForAlertsState(scenario.ExpectedAlerts, "pending", ctx, t); err != nil {
+		return fmt.Errorf("%s: %w", scenario.Name, err)
+	}
+	if err := waitForAlertsState(scenario.ExpectedAlerts, "firing", ctx, t); err != nil {
+		return fmt.Errorf("%s: %w", scenario.Name, err)
+	}
+
+	if err := checkAlertManagerForAlerts(ctx, scenario.ExpectedAlerts); err != nil {
+		return fmt.Errorf("%s: %w", scenario.Name, err)
+	}
+
+	return nil
+}
+
+// getAlertsState queries Prometheus for the current state ("none", "pending"
+// or "firing") of each of alertNames.
+func getAlertsState(alertNames []string, ctx *TestingContext) (map[string]string, error) {
+	output, err := execToPod("curl localhost:9090/api/v1/alerts",
+		"prometheus-application-monitoring-0",
+		MonitoringOperatorNamespace,
+		"prometheus",
+		ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to exec to prometheus pod: %w", err)
+	}
+
+	var promAPICallOutput prometheusAPIResponse
+	if err := json.Unmarshal([]byte(output), &promAPICallOutput); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal json: %w", err)
+	}
+
+	var alertsResult struct {
+		Alerts []struct {
+			Labels map[string]string `json:"labels"`
+			State  string            `json:"state"`
+		} `json:"alerts"`
+	}
+	if err := json.Unmarshal(promAPICallOutput.Data, &alertsResult); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal json: %w", err)
+	}
+
+	states := make(map[string]string, len(alertNames))
+	for _, alertName := range alertNames {
+		states[alertName] = "none"
+	}
+
+	for _, alert := range alertsResult.Alerts {
+		alertName := alert.Labels["alertname"]
+		if _, ok := states[alertName]; ok {
+			states[alertName] = alert.State
+		}
+	}
+
+	return states, nil
+}
+
+func waitForAlertsState(alertNames []string, expectedState string, ctx *TestingContext, t *testing.T) error {
+	monitoringTimeout := 15 * time.Minute
+	monitoringRetryInterval := time.Minute
+
+	return k8swait.PollImmediate(monitoringRetryInterval, monitoringTimeout, func() (done bool, err error) {
+		states, err := getAlertsState(alertNames, ctx)
+		if err != nil {
+			t.Log("failed to get alert state:", err)
+			t.Log("waiting 1 minute before retrying")
+			return false, nil
+		}
+
+		allInExpectedState := true
+		for alertName, state := range states {
+			if state != expectedState {
+				allInExpectedState = false
+				t.Log(alertName+" alert is not in expected state ("+expectedState+") yet, current state:", state)
+			}
+		}
+
+		if allInExpectedState {
+			return true, nil
+		}
+
+		t.Log("waiting 1 minute before retrying")
+		return false, nil
+	})
+}
+
+func checkAlertManagerForAlerts(ctx *TestingContext, alertNames []string) error {
+	output, err := execToPod("amtool alert --alertmanager.url=http://localhost:9093",
+		"alertmanager-application-monitoring-0",
+		MonitoringOperatorNamespace,
+		"alertmanager",
+		ctx)
+	if err != nil {
+		return fmt.Errorf("failed to exec to alertmanager pod: %w", err)
+	}
+
+	for _, alertName := range alertNames {
+		if !strings.Contains(output, alertName) {
+			return fmt.Errorf("%s alert not firing in alertmanager", alertName)
+		}
+	}
+
+	return nil
+}
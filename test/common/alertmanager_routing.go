@@ -0,0 +1,202 @@
+package common
+
+import (
+	"fmt"
+	"regexp"
+	"testing"
+
+	"gopkg.in/yaml.v2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// expectedRootRoute describes the values the root of the alertmanager route
+// tree must have.
+var expectedRootRoute = alertManagerRoute{
+	Receiver:       "default",
+	GroupBy:        []string{"job"},
+	GroupWait:      "30s",
+	GroupInterval:  "5m",
+	RepeatInterval: "12h",
+}
+
+// routeResolutionCases are a table of label sets and the receiver they must
+// resolve to, covering the child routes RHMI configures.
+var routeResolutionCases = []struct {
+	name     string
+	labels   map[string]string
+	receiver string
+}{
+	{
+		name:     "critical alert pages",
+		labels:   map[string]string{"alertname": "RHMIFuseOnlineSyndesisUiServiceEndpointDown", "severity": "critical", "product": "fuse"},
+		receiver: "critical",
+	},
+	{
+		name:     "dead man's switch",
+		labels:   map[string]string{"alertname": "DeadMansSwitch"},
+		receiver: "deadmansswitch",
+	},
+	{
+		name:     "3scale critical alert pages",
+		labels:   map[string]string{"alertname": "ThreeScaleApicastProductionPodCount", "severity": "critical", "product": "3scale"},
+		receiver: "critical",
+	},
+	{
+		name:     "warning alert does not page",
+		labels:   map[string]string{"alertname": "RHMIFuseOnlineSyndesisUiServiceEndpointDown", "severity": "warning", "product": "fuse"},
+		receiver: "default",
+	},
+}
+
+// TestAlertManagerRouting verifies that the alertmanager-application-monitoring
+// secret configures a route tree and inhibition rules that dispatch alerts to
+// the receivers RHMI expects, rather than only checking that the receivers
+// themselves exist.
+func TestAlertManagerRouting(t *testing.T, ctx *TestingContext) {
+	config, err := getAlertManagerConfig(ctx.KubeClient)
+	if err != nil {
+		t.Fatal("failed to get alertmanager config", err)
+	}
+
+	if err := verifyRoutingTree(config.Route); err != nil {
+		t.Error("route tree is misconfigured:", err)
+	}
+
+	if err := verifyInhibitRules(config.InhibitRules); err != nil {
+		t.Error("inhibit rules are misconfigured:", err)
+	}
+
+	for _, testCase := range routeResolutionCases {
+		receiver := resolveReceiver(config.Route, testCase.labels)
+		if receiver != testCase.receiver {
+			t.Errorf("%s: expected labels %v to resolve to receiver %q, got %q", testCase.name, testCase.labels, testCase.receiver, receiver)
+		}
+	}
+}
+
+func getAlertManagerConfig(kubeClient kubernetes.Interface) (*alertManagerConfig, error) {
+	res, err := kubeClient.CoreV1().Secrets(MonitoringOperatorNamespace).Get("alertmanager-application-monitoring", metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get secret: %w", err)
+	}
+
+	var config alertManagerConfig
+	if err := yaml.Unmarshal(res.Data["alertmanager.yaml"], &config); err != nil {
+		return nil, fmt.Errorf("failed to parse yaml: %w", err)
+	}
+
+	return &config, nil
+}
+
+// verifyRoutingTree checks the root route's grouping and timing settings,
+// and that a child route exists routing severity="critical" to pagerduty and
+// alertname="DeadMansSwitch" to deadmansswitch.
+func verifyRoutingTree(root alertManagerRoute) error {
+	if root.Receiver != expectedRootRoute.Receiver {
+		return fmt.Errorf("root receiver is %q, expected %q", root.Receiver, expectedRootRoute.Receiver)
+	}
+	if !stringSlicesEqual(root.GroupBy, expectedRootRoute.GroupBy) {
+		return fmt.Errorf("root group_by is %v, expected %v", root.GroupBy, expectedRootRoute.GroupBy)
+	}
+	if root.GroupWait != expectedRootRoute.GroupWait {
+		return fmt.Errorf("root group_wait is %q, expected %q", root.GroupWait, expectedRootRoute.GroupWait)
+	}
+	if root.GroupInterval != expectedRootRoute.GroupInterval {
+		return fmt.Errorf("root group_interval is %q, expected %q", root.GroupInterval, expectedRootRoute.GroupInterval)
+	}
+	if root.RepeatInterval != expectedRootRoute.RepeatInterval {
+		return fmt.Errorf("root repeat_interval is %q, expected %q", root.RepeatInterval, expectedRootRoute.RepeatInterval)
+	}
+
+	if resolveReceiver(root, map[string]string{"alertname": "AnyAlert", "severity": "critical"}) != "critical" {
+		return fmt.Errorf("no child route sends severity=critical alerts to the critical receiver")
+	}
+	if resolveReceiver(root, map[string]string{"alertname": "DeadMansSwitch"}) != "deadmansswitch" {
+		return fmt.Errorf("no child route sends DeadMansSwitch to the deadmansswitch receiver")
+	}
+
+	return nil
+}
+
+// verifyInhibitRules checks that a warning alert is inhibited by a firing
+// critical alert with the same alertname and namespace.
+func verifyInhibitRules(rules []alertManagerInhibitRule) error {
+	for _, rule := range rules {
+		if rule.SourceMatch["severity"] != "critical" || rule.TargetMatch["severity"] != "warning" {
+			continue
+		}
+
+		equal := make(map[string]bool, len(rule.Equal))
+		for _, label := range rule.Equal {
+			equal[label] = true
+		}
+
+		if equal["alertname"] && equal["namespace"] {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("no inhibit rule suppresses warning alerts when the equivalent critical alert is firing on the same alertname and namespace")
+}
+
+// resolveReceiver walks route's tree depth-first, mirroring Alertmanager's
+// own dispatch algorithm: the first matching route wins unless it sets
+// continue: true, in which case matching carries on to its siblings. A route
+// with no receiver of its own inherits the receiver of whichever route
+// matched above it.
+func resolveReceiver(route alertManagerRoute, labels map[string]string) string {
+	return resolveReceiverFrom(route, labels, route.Receiver)
+}
+
+// resolveReceiverFrom is resolveReceiver's recursive step. inherited is the
+// receiver route would resolve to if none of its children matched or set
+// their own receiver.
+func resolveReceiverFrom(route alertManagerRoute, labels map[string]string, inherited string) string {
+	receiver := inherited
+	if route.Receiver != "" {
+		receiver = route.Receiver
+	}
+
+	for _, child := range route.Routes {
+		if !routeMatches(child, labels) {
+			continue
+		}
+
+		receiver = resolveReceiverFrom(child, labels, receiver)
+		if !child.Continue {
+			break
+		}
+	}
+
+	return receiver
+}
+
+func stringSlicesEqual(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i, v := range a {
+		if v != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func routeMatches(route alertManagerRoute, labels map[string]string) bool {
+	for key, value := range route.Match {
+		if labels[key] != value {
+			return false
+		}
+	}
+
+	for key, pattern := range route.MatchRE {
+		matched, err := regexp.MatchString("^(?:"+pattern+")$", labels[key])
+		if err != nil || !matched {
+			return false
+		}
+	}
+
+	return true
+}
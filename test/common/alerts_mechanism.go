@@ -2,25 +2,18 @@ package common
 
 import (
 	goctx "context"
-	"encoding/json"
 	"fmt"
-	"strings"
 	"testing"
-	"time"
 
 	appsv1 "github.com/openshift/api/apps/v1"
-	prometheusv1 "github.com/prometheus/client_golang/api/prometheus/v1"
 	"gopkg.in/yaml.v2"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/util/retry"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	k8sclient "sigs.k8s.io/controller-runtime/pkg/client"
 )
 
-type repeatFunc func()
-
 type alertManagerConfig struct {
 	Global struct {
 		SMTPSmartHost    string `yaml:"smtp_smarthost"`
@@ -28,7 +21,31 @@ type alertManagerConfig struct {
 		SMTPAuthPassword string `yaml:"smtp_auth_password"`
 	} `yaml:"global"`
 
-	Receivers []map[string]interface{} `yaml:"receivers"`
+	Route        alertManagerRoute         `yaml:"route"`
+	InhibitRules []alertManagerInhibitRule `yaml:"inhibit_rules"`
+	Receivers    []map[string]interface{}  `yaml:"receivers"`
+}
+
+// alertManagerRoute mirrors the subset of Alertmanager's route tree that RHMI
+// configures, used to assert the routing behaviour rather than just the
+// presence of each receiver.
+type alertManagerRoute struct {
+	Receiver       string              `yaml:"receiver"`
+	GroupBy        []string            `yaml:"group_by"`
+	GroupWait      string              `yaml:"group_wait"`
+	GroupInterval  string              `yaml:"group_interval"`
+	RepeatInterval string              `yaml:"repeat_interval"`
+	Match          map[string]string   `yaml:"match"`
+	MatchRE        map[string]string   `yaml:"match_re"`
+	Continue       bool                `yaml:"continue"`
+	Routes         []alertManagerRoute `yaml:"routes"`
+}
+
+// alertManagerInhibitRule mirrors an Alertmanager inhibit_rules entry.
+type alertManagerInhibitRule struct {
+	SourceMatch map[string]string `yaml:"source_match"`
+	TargetMatch map[string]string `yaml:"target_match"`
+	Equal       []string          `yaml:"equal"`
 }
 
 const (
@@ -36,48 +53,18 @@ const (
 	fuseUIDeploymentConfigName = "syndesis-ui"
 )
 
-var fuseAlertsToTest = map[string]string{
-	"FuseOnlineSyndesisUIInstanceDown":            "none",
-	"RHMIFuseOnlineSyndesisUiServiceEndpointDown": "none",
-}
-
-// TestIntegreatlyAlertsMechanism verifies that alert mechanism works
+// TestIntegreatlyAlertsMechanism verifies that the alert mechanism works by
+// running every registered AlertScenario (one per RHMI product) and
+// confirming the alertmanager configuration is correctly set up.
 func TestIntegreatlyAlertsMechanism(t *testing.T, ctx *TestingContext) {
-	// verify that alert to be tested is not firing before starting the test
-	err := getFuseAlertState(ctx)
-	if err != nil {
-		t.Fatal("failed to get fuse alert state", err)
-	}
-
-	fuseAlertsFiring := false
-
-	// check if any alerts are firing before test execution
-	for fuseAlertName, fuseAlertState := range fuseAlertsToTest {
-		if fuseAlertState != "none" {
-			fuseAlertsFiring = true
-			t.Errorf("%s alert should not be firing", fuseAlertName)
+	for _, scenario := range alertScenarios {
+		if err := RunAlertScenario(t, ctx, scenario); err != nil {
+			t.Error(err)
 		}
 	}
 
-	// fail test if any alerts are firing
-	if fuseAlertsFiring {
-		t.FailNow()
-	}
-
-	// scale down Fuse operator and UI pods and verify that fuse alert is firing
-	err = performTest(t, ctx)
-	if err != nil {
-		t.Fatal(err)
-	}
-
-	// verify that fuse alert is not firing
-	err = waitForFuseAlertState("none", ctx, t)
-	if err != nil {
-		t.Fatal(err)
-	}
-
 	// verify alertmanager-application-monitoring secret
-	err = verifySecrets(ctx.KubeClient)
+	err := verifySecrets(ctx.KubeClient)
 	if err != nil {
 		t.Fatal("failed to verify alertmanager-application-monitoring secret", err)
 	}
@@ -142,156 +129,6 @@ func verifySecrets(kubeClient kubernetes.Interface) error {
 	return nil
 }
 
-func performTest(t *testing.T, ctx *TestingContext) error {
-	originalOperatorReplicas, err := getNumOfReplicasDeployment(fuseOperatorDeploymentName, FuseOperatorNamespace, ctx.KubeClient)
-	if err != nil {
-		return fmt.Errorf("failed to get number of replicas: %w", err)
-	}
-
-	originalUIReplicas, err := getNumOfReplicasDeploymentConfig(fuseUIDeploymentConfigName, FuseProductNamespace, ctx.Client)
-	if err != nil {
-		return fmt.Errorf("failed to get number of replicas: %w", err)
-	}
-
-	quit1 := make(chan struct{})
-	go repeat(func() {
-		scaleDeployment(fuseOperatorDeploymentName, FuseOperatorNamespace, 0, ctx.KubeClient)
-	}, quit1)
-	defer close(quit1)
-	defer scaleDeployment(fuseOperatorDeploymentName, FuseOperatorNamespace, originalOperatorReplicas, ctx.KubeClient)
-
-	quit2 := make(chan struct{})
-	go repeat(func() {
-		scaleDeploymentConfig(fuseUIDeploymentConfigName, FuseProductNamespace, 0, ctx.Client)
-	}, quit2)
-	defer close(quit2)
-	defer scaleDeploymentConfig(fuseUIDeploymentConfigName, FuseProductNamespace, originalUIReplicas, ctx.Client)
-
-	err = waitForFuseAlertState("pending", ctx, t)
-	if err != nil {
-		return err
-	}
-
-	err = waitForFuseAlertState("firing", ctx, t)
-	if err != nil {
-		return err
-	}
-
-	err = checkAlertManager(ctx)
-	return err
-}
-
-func checkAlertManager(ctx *TestingContext) error {
-	output, err := execToPod("amtool alert --alertmanager.url=http://localhost:9093",
-		"alertmanager-application-monitoring-0",
-		MonitoringOperatorNamespace,
-		"alertmanager",
-		ctx)
-	if err != nil {
-		return fmt.Errorf("failed to exec to alertmanger pod: %w", err)
-	}
-
-	for fuseAlertName := range fuseAlertsToTest {
-		if !strings.Contains(output, fuseAlertName) {
-			return fmt.Errorf("%s alert not firing in alertmanager", fuseAlertName)
-		}
-	}
-
-	return nil
-}
-
-func repeat(function repeatFunc, quit chan struct{}) {
-	for {
-		select {
-		case <-quit:
-			return
-		default:
-			function()
-		}
-	}
-}
-
-func waitForFuseAlertState(expectedState string, ctx *TestingContext, t *testing.T) error {
-	monitoringTimeout := 15 * time.Minute
-	monitoringRetryInterval := time.Minute
-	err := wait.PollImmediate(monitoringRetryInterval, monitoringTimeout, func() (done bool, err error) {
-		err = getFuseAlertState(ctx)
-		if err != nil {
-			t.Log("failed to get fuse alert state:", err)
-			t.Log("waiting 1 minute before retrying")
-			return false, nil
-		}
-
-		alertsInExpectedState := true
-		for fuseAlertName, fuseAlertState := range fuseAlertsToTest {
-			if fuseAlertState != expectedState {
-				alertsInExpectedState = false
-				t.Log(fuseAlertName+" alert is not in expected state ("+expectedState+") yet, current state:", fuseAlertState)
-				t.Log("waiting 1 minute before retrying")
-			}
-		}
-
-		if alertsInExpectedState {
-			return true, nil
-		}
-
-		return false, nil
-	})
-
-	return err
-}
-
-func getFuseAlertState(ctx *TestingContext) error {
-	output, err := execToPod("curl localhost:9090/api/v1/alerts",
-		"prometheus-application-monitoring-0",
-		MonitoringOperatorNamespace,
-		"prometheus",
-		ctx)
-	if err != nil {
-		return fmt.Errorf("failed to exec to prometheus pod: %w", err)
-	}
-
-	var promAPICallOutput prometheusAPIResponse
-	err = json.Unmarshal([]byte(output), &promAPICallOutput)
-	if err != nil {
-		return fmt.Errorf("failed to unmarshal json: %w", err)
-	}
-
-	var alertsResult prometheusv1.AlertsResult
-	err = json.Unmarshal(promAPICallOutput.Data, &alertsResult)
-	if err != nil {
-		return fmt.Errorf("failed to unmarshal json: %w", err)
-	}
-
-	// reset the state to "none" as the prom api only returns alerts that are triggering hence the state needs to be reset.
-	for fuseAlertName := range fuseAlertsToTest {
-		fuseAlertsToTest[fuseAlertName] = "none"
-	}
-
-	for _, alert := range alertsResult.Alerts {
-		alertName := string(alert.Labels["alertname"])
-
-		for fuseAlertName := range fuseAlertsToTest {
-			if alertName == fuseAlertName {
-				fuseAlertsToTest[fuseAlertName] = string(alert.State)
-			}
-		}
-	}
-
-	return nil
-}
-
-func getNumOfReplicasDeployment(name string, namespace string, kubeClient kubernetes.Interface) (int32, error) {
-	deploymentsClient := kubeClient.AppsV1().Deployments(FuseOperatorNamespace)
-
-	result, getErr := deploymentsClient.Get(name, metav1.GetOptions{})
-	if getErr != nil {
-		return 0, fmt.Errorf("Failed to get latest version of Deployment: %v", getErr)
-	}
-
-	return *result.Spec.Replicas, nil
-}
-
 func getNumOfReplicasDeploymentConfig(name string, namespace string, client client.Client) (int32, error) {
 	deploymentConfig := &appsv1.DeploymentConfig{
 		ObjectMeta: metav1.ObjectMeta{
@@ -307,27 +144,12 @@ func getNumOfReplicasDeploymentConfig(name string, namespace string, client clie
 	return deploymentConfig.Spec.Replicas, nil
 }
 
-func scaleDeployment(name string, namespace string, replicas int32, kubeClient kubernetes.Interface) error {
-	deploymentsClient := kubeClient.AppsV1().Deployments(FuseOperatorNamespace)
-
-	retryErr := retry.RetryOnConflict(retry.DefaultRetry, func() error {
-		result, getErr := deploymentsClient.Get(name, metav1.GetOptions{})
-		if getErr != nil {
-			return fmt.Errorf("Failed to get latest version of Deployment: %v", getErr)
-		}
-
-		result.Spec.Replicas = &replicas
-		_, updateErr := deploymentsClient.Update(result)
-		return updateErr
-	})
-	if retryErr != nil {
-		return fmt.Errorf("Update failed: %v", retryErr)
-	}
-
-	return nil
-}
-
-func scaleDeploymentConfig(name string, namespace string, replicas int32, client client.Client) error {
+// scaleDeploymentConfig scales a DeploymentConfig to replicas. When paused is
+// true it also sets pausedAnnotation, and when paused is false it removes it,
+// which is how Restore clears the annotation again. Nothing reconciles on the
+// annotation, so it does not stop the owning operator from scaling the
+// DeploymentConfig back.
+func scaleDeploymentConfig(name string, namespace string, replicas int32, paused bool, client client.Client) error {
 	retryErr := retry.RetryOnConflict(retry.DefaultRetry, func() error {
 		deploymentConfig := &appsv1.DeploymentConfig{
 			ObjectMeta: metav1.ObjectMeta{
@@ -340,6 +162,15 @@ func scaleDeploymentConfig(name string, namespace string, replicas int32, client
 			return fmt.Errorf("Failed to get DeploymentConfig %s in namespace %s with error: %s", name, namespace, getErr)
 		}
 
+		if paused {
+			if deploymentConfig.Annotations == nil {
+				deploymentConfig.Annotations = map[string]string{}
+			}
+			deploymentConfig.Annotations[pausedAnnotation] = "true"
+		} else {
+			delete(deploymentConfig.Annotations, pausedAnnotation)
+		}
+
 		deploymentConfig.Spec.Replicas = replicas
 		updateErr := client.Update(goctx.TODO(), deploymentConfig)
 		return updateErr
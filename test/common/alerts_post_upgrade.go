@@ -0,0 +1,139 @@
+package common
+
+import (
+	goctx "context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	integreatlyv1alpha1 "github.com/integr8ly/integreatly-operator/pkg/apis/integreatly/v1alpha1"
+	prometheusv1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	k8sclient "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// expectedUpgradeVersionEnvVar is the RHMI version the upgrade test runner
+// set out to upgrade to. By the time the RHMI CR reaches the Complete stage,
+// status.version has already caught up to status.toVersion and toVersion has
+// been cleared back to "", so the two can never be compared directly to
+// detect "just upgraded" - the expected version has to be supplied from
+// outside the CR instead.
+const expectedUpgradeVersionEnvVar = "RHMI_UPGRADE_TO_VERSION"
+
+// postUpgradeSettleTime is how long we wait after the upgrade completes for
+// transient alerts (e.g. those triggered by pod restarts) to clear before we
+// start asserting on the critical alert state.
+const postUpgradeSettleTime = 5 * time.Minute
+
+// postUpgradeAlertWindow is the Prometheus query window used to look back for
+// critical alerts once the settle time has elapsed.
+const postUpgradeAlertWindow = "1m"
+
+// postUpgradeCriticalAlertsAllowList are critical alerts that are expected to
+// fire around an upgrade and should not fail the test.
+var postUpgradeCriticalAlertsAllowList = map[string]bool{
+	"DeadMansSwitch": true,
+}
+
+// TestPostUpgradeCriticalAlerts verifies that no unexpected critical alerts
+// have been firing in the period immediately following an RHMI upgrade. It
+// is intended to run as part of the post-upgrade test suite, alongside
+// TestIntegreatlyAlertsMechanism, and is skipped when the cluster does not
+// appear to have just completed an upgrade.
+func TestPostUpgradeCriticalAlerts(t *testing.T, ctx *TestingContext) {
+	rhmi, err := getRHMICustomResource(ctx.Client)
+	if err != nil {
+		t.Fatal("failed to get RHMI custom resource", err)
+	}
+
+	if !hasJustUpgraded(rhmi) {
+		t.Skip("cluster does not appear to have just completed an upgrade, skipping")
+		return
+	}
+
+	t.Logf("upgrade to version %s detected, waiting %s for transient alerts to settle", rhmi.Status.Version, postUpgradeSettleTime)
+	time.Sleep(postUpgradeSettleTime)
+
+	firing, err := getFiringCriticalAlerts(ctx)
+	if err != nil {
+		t.Fatal("failed to query firing critical alerts", err)
+	}
+
+	for _, alert := range firing {
+		alertName := string(alert["alertname"])
+		if postUpgradeCriticalAlertsAllowList[alertName] {
+			continue
+		}
+
+		namespace := string(alert["namespace"])
+		t.Errorf("critical alert %s in namespace %s was firing in the post-upgrade window, labels: %v", alertName, namespace, alert)
+	}
+}
+
+// hasJustUpgraded returns true when the RHMI CR reports that it has finished
+// reconciling the version recorded in expectedUpgradeVersionEnvVar. By the
+// Complete stage status.toVersion has already been cleared to "" and
+// status.version has caught up to it, so the two can't be compared against
+// each other - the expected version has to come from the env var the upgrade
+// test runner sets before invoking this suite. Returns false (and the caller
+// skips) when the env var isn't set, e.g. when this isn't running as part of
+// an upgrade test.
+func hasJustUpgraded(rhmi *integreatlyv1alpha1.RHMI) bool {
+	expectedVersion := os.Getenv(expectedUpgradeVersionEnvVar)
+	if expectedVersion == "" {
+		return false
+	}
+
+	return rhmi.Status.Stage == integreatlyv1alpha1.CompleteStage && rhmi.Status.Version == expectedVersion
+}
+
+func getRHMICustomResource(client k8sclient.Client) (*integreatlyv1alpha1.RHMI, error) {
+	rhmiList := &integreatlyv1alpha1.RHMIList{}
+	err := client.List(goctx.TODO(), rhmiList, k8sclient.InNamespace(RHMIOperatorNamespace))
+	if err != nil {
+		return nil, fmt.Errorf("error listing RHMI CR: %w", err)
+	}
+
+	if len(rhmiList.Items) != 1 {
+		return nil, fmt.Errorf("expected one RHMI CR, got %d", len(rhmiList.Items))
+	}
+
+	return &rhmiList.Items[0], nil
+}
+
+// getFiringCriticalAlerts queries Prometheus for every ALERTS series with
+// alertstate="firing" and severity="critical" over the last
+// postUpgradeAlertWindow, and returns the label set for each matching series.
+func getFiringCriticalAlerts(ctx *TestingContext) ([]prometheusv1.LabelSet, error) {
+	query := fmt.Sprintf(`curl -s 'localhost:9090/api/v1/query?query=ALERTS{alertstate="firing",severity="critical"}[%s]'`, postUpgradeAlertWindow)
+	output, err := execToPod(query,
+		"prometheus-application-monitoring-0",
+		MonitoringOperatorNamespace,
+		"prometheus",
+		ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to exec to prometheus pod: %w", err)
+	}
+
+	var promAPICallOutput prometheusAPIResponse
+	if err := json.Unmarshal([]byte(output), &promAPICallOutput); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal json: %w", err)
+	}
+
+	var result struct {
+		Result []struct {
+			Metric prometheusv1.LabelSet `json:"metric"`
+		} `json:"result"`
+	}
+	if err := json.Unmarshal(promAPICallOutput.Data, &result); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal json: %w", err)
+	}
+
+	labelSets := make([]prometheusv1.LabelSet, 0, len(result.Result))
+	for _, series := range result.Result {
+		labelSets = append(labelSets, series.Metric)
+	}
+
+	return labelSets, nil
+}
@@ -0,0 +1,301 @@
+package common
+
+import (
+	goctx "context"
+	"fmt"
+
+	osappsv1 "github.com/openshift/api/apps/v1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	k8serr "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/retry"
+	k8sclient "sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/integr8ly/integreatly-operator/pkg/common/wait"
+)
+
+// pausedAnnotation marks a workload as intentionally held in a disrupted
+// state by the alert test harness, for operators and humans inspecting the
+// resource to see that the low replica count is deliberate. No reconciler in
+// this repo currently honours it, so it does not by itself stop the owning
+// controller from reverting the disruption - RunAlertScenario is what keeps
+// the disruption in place, by periodically re-applying it for as long as the
+// scenario runs.
+const pausedAnnotation = "monitoring.integreatly.org/paused"
+
+// Disruption is something the alert harness can apply to the cluster to
+// provoke an alert, and later undo to restore the cluster to its original
+// state. Implementations must be safe to Restore even if Apply was never
+// called or failed partway through. RunAlertScenario re-invokes Apply
+// repeatedly to hold the disruption in place for as long as the scenario
+// runs, so Apply must capture whatever pre-disruption state Restore needs
+// only once, on its first call - not on every re-apply.
+type Disruption interface {
+	// Apply provokes the disruption.
+	Apply(ctx *TestingContext) error
+	// Restore undoes the disruption, returning the affected resource(s) to
+	// the state they were in before Apply was called.
+	Restore(ctx *TestingContext) error
+	// String describes the disruption for log output.
+	String() string
+}
+
+// ReadinessTarget is implemented by Disruptions whose effect can be
+// confirmed directly against the disrupted resource, via pkg/common/wait,
+// rather than only by waiting for the Prometheus alert it's expected to
+// cause.
+type ReadinessTarget interface {
+	WaitTarget() wait.Target
+}
+
+// ScaleDeployment scales a Deployment to Replicas, restoring it to its
+// original replica count on Restore.
+type ScaleDeployment struct {
+	Name, Namespace string
+	Replicas        int32
+
+	original int32
+	captured bool
+}
+
+func (s *ScaleDeployment) Apply(ctx *TestingContext) error {
+	deploymentsClient := ctx.KubeClient.AppsV1().Deployments(s.Namespace)
+
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		result, err := deploymentsClient.Get(s.Name, metav1.GetOptions{})
+		if err != nil {
+			return fmt.Errorf("failed to get deployment %s/%s: %w", s.Namespace, s.Name, err)
+		}
+
+		// Only ever capture the pre-disruption replica count on the first
+		// Apply. RunAlertScenario re-invokes Apply on a ticker to hold the
+		// disruption in place, and by the second call result.Spec.Replicas is
+		// already s.Replicas - capturing unconditionally would overwrite the
+		// real original with the disrupted value.
+		if !s.captured {
+			s.original = *result.Spec.Replicas
+			s.captured = true
+		}
+
+		if result.Annotations == nil {
+			result.Annotations = map[string]string{}
+		}
+		result.Annotations[pausedAnnotation] = "true"
+		result.Spec.Replicas = &s.Replicas
+		_, err = deploymentsClient.Update(result)
+		return err
+	})
+}
+
+func (s *ScaleDeployment) Restore(ctx *TestingContext) error {
+	if !s.captured {
+		return nil
+	}
+
+	deploymentsClient := ctx.KubeClient.AppsV1().Deployments(s.Namespace)
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		result, err := deploymentsClient.Get(s.Name, metav1.GetOptions{})
+		if err != nil {
+			return fmt.Errorf("failed to get deployment %s/%s: %w", s.Namespace, s.Name, err)
+		}
+
+		delete(result.Annotations, pausedAnnotation)
+		result.Spec.Replicas = &s.original
+		_, err = deploymentsClient.Update(result)
+		return err
+	})
+	return err
+}
+
+func (s *ScaleDeployment) String() string {
+	return fmt.Sprintf("scale deployment %s/%s to %d replicas", s.Namespace, s.Name, s.Replicas)
+}
+
+func (s *ScaleDeployment) WaitTarget() wait.Target {
+	return wait.Target{
+		Object: &appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: s.Name, Namespace: s.Namespace},
+		},
+		Predicate: wait.ReadyReplicas(s.Replicas),
+	}
+}
+
+// ScaleDeploymentConfig scales an OpenShift DeploymentConfig to Replicas,
+// restoring it to its original replica count on Restore.
+type ScaleDeploymentConfig struct {
+	Name, Namespace string
+	Replicas        int32
+
+	original int32
+	captured bool
+}
+
+func (s *ScaleDeploymentConfig) Apply(ctx *TestingContext) error {
+	// Only ever capture the pre-disruption replica count on the first Apply -
+	// RunAlertScenario re-invokes Apply on a ticker to hold the disruption in
+	// place, and by the second call the DeploymentConfig is already scaled to
+	// s.Replicas, so capturing unconditionally would overwrite the real
+	// original with the disrupted value and strand it there on Restore.
+	if !s.captured {
+		original, err := getNumOfReplicasDeploymentConfig(s.Name, s.Namespace, ctx.Client)
+		if err != nil {
+			return err
+		}
+		s.original = original
+		s.captured = true
+	}
+
+	return scaleDeploymentConfig(s.Name, s.Namespace, s.Replicas, true, ctx.Client)
+}
+
+func (s *ScaleDeploymentConfig) Restore(ctx *TestingContext) error {
+	if !s.captured {
+		return nil
+	}
+
+	return scaleDeploymentConfig(s.Name, s.Namespace, s.original, false, ctx.Client)
+}
+
+func (s *ScaleDeploymentConfig) String() string {
+	return fmt.Sprintf("scale deployment config %s/%s to %d replicas", s.Namespace, s.Name, s.Replicas)
+}
+
+func (s *ScaleDeploymentConfig) WaitTarget() wait.Target {
+	return wait.Target{
+		Object: &osappsv1.DeploymentConfig{
+			ObjectMeta: metav1.ObjectMeta{Name: s.Name, Namespace: s.Namespace},
+		},
+		Predicate: wait.ReadyReplicas(s.Replicas),
+	}
+}
+
+// DeletePod deletes every pod matching LabelSelector in Namespace. The
+// owning controller is expected to recreate them, so Restore is a no-op.
+type DeletePod struct {
+	Namespace     string
+	LabelSelector string
+}
+
+func (d *DeletePod) Apply(ctx *TestingContext) error {
+	pods, err := ctx.KubeClient.CoreV1().Pods(d.Namespace).List(metav1.ListOptions{LabelSelector: d.LabelSelector})
+	if err != nil {
+		return fmt.Errorf("failed to list pods matching %s in %s: %w", d.LabelSelector, d.Namespace, err)
+	}
+
+	for _, pod := range pods.Items {
+		if err := ctx.KubeClient.CoreV1().Pods(d.Namespace).Delete(pod.Name, &metav1.DeleteOptions{}); err != nil {
+			return fmt.Errorf("failed to delete pod %s/%s: %w", d.Namespace, pod.Name, err)
+		}
+	}
+
+	return nil
+}
+
+func (d *DeletePod) Restore(ctx *TestingContext) error {
+	return nil
+}
+
+func (d *DeletePod) String() string {
+	return fmt.Sprintf("delete pods matching %q in %s", d.LabelSelector, d.Namespace)
+}
+
+// BreakService patches a Service's selector so that it no longer matches any
+// pods, simulating an endpoint outage. Restore reinstates the original
+// selector.
+type BreakService struct {
+	Name, Namespace string
+
+	original map[string]string
+	captured bool
+}
+
+func (b *BreakService) Apply(ctx *TestingContext) error {
+	svc := &corev1.Service{}
+	if err := ctx.Client.Get(goctx.TODO(), k8sclient.ObjectKey{Name: b.Name, Namespace: b.Namespace}, svc); err != nil {
+		return fmt.Errorf("failed to get service %s/%s: %w", b.Namespace, b.Name, err)
+	}
+
+	// Only ever capture the original selector on the first Apply -
+	// RunAlertScenario re-invokes Apply on a ticker to hold the disruption in
+	// place, and by the second call the service already carries the sabotage
+	// selector, so capturing unconditionally would overwrite the real
+	// original selector with the broken one and strand it there on Restore.
+	if !b.captured {
+		b.original = svc.Spec.Selector
+		b.captured = true
+	}
+	svc.Spec.Selector = map[string]string{"integreatly-alert-test": "break-service"}
+
+	return ctx.Client.Update(goctx.TODO(), svc)
+}
+
+func (b *BreakService) Restore(ctx *TestingContext) error {
+	if !b.captured {
+		return nil
+	}
+
+	svc := &corev1.Service{}
+	if err := ctx.Client.Get(goctx.TODO(), k8sclient.ObjectKey{Name: b.Name, Namespace: b.Namespace}, svc); err != nil {
+		return fmt.Errorf("failed to get service %s/%s: %w", b.Namespace, b.Name, err)
+	}
+
+	svc.Spec.Selector = b.original
+	return ctx.Client.Update(goctx.TODO(), svc)
+}
+
+func (b *BreakService) String() string {
+	return fmt.Sprintf("break service selector for %s/%s", b.Namespace, b.Name)
+}
+
+// BlockEgressNetworkPolicy applies a NetworkPolicy to Namespace that denies
+// all egress traffic from pods matching PodSelector, and removes it on
+// Restore.
+type BlockEgressNetworkPolicy struct {
+	Namespace   string
+	PodSelector metav1.LabelSelector
+
+	policyName string
+}
+
+func (b *BlockEgressNetworkPolicy) Apply(ctx *TestingContext) error {
+	b.policyName = "integreatly-alert-test-block-egress"
+
+	policy := &networkingv1.NetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      b.policyName,
+			Namespace: b.Namespace,
+		},
+		Spec: networkingv1.NetworkPolicySpec{
+			PodSelector: b.PodSelector,
+			PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeEgress},
+			Egress:      []networkingv1.NetworkPolicyEgressRule{},
+		},
+	}
+
+	_, err := ctx.KubeClient.NetworkingV1().NetworkPolicies(b.Namespace).Create(policy)
+	if err != nil && k8serr.IsAlreadyExists(err) {
+		// RunAlertScenario re-invokes Apply on a ticker to hold the
+		// disruption in place; the policy from the first Apply is still
+		// there, so there's nothing left to do.
+		return nil
+	}
+	return err
+}
+
+func (b *BlockEgressNetworkPolicy) Restore(ctx *TestingContext) error {
+	if b.policyName == "" {
+		return nil
+	}
+
+	err := ctx.KubeClient.NetworkingV1().NetworkPolicies(b.Namespace).Delete(b.policyName, &metav1.DeleteOptions{})
+	if err != nil && k8serr.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+func (b *BlockEgressNetworkPolicy) String() string {
+	return fmt.Sprintf("block egress traffic from pods matching %v in %s", b.PodSelector, b.Namespace)
+}
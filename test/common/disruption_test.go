@@ -0,0 +1,90 @@
+package common
+
+import (
+	goctx "context"
+	"testing"
+
+	osappsv1 "github.com/openshift/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8sclient "sigs.k8s.io/controller-runtime/pkg/client"
+	fakeclient "sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// TestScaleDeploymentConfigReassertThenRestore guards against a regression
+// where re-invoking Apply (as RunAlertScenario does on a ticker, to hold the
+// disruption in place) clobbered the captured original replica count with
+// the already-disrupted value, leaving Restore unable to scale back up.
+func TestScaleDeploymentConfigReassertThenRestore(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := osappsv1.AddToScheme(scheme); err != nil {
+		t.Fatalf("failed to register scheme: %v", err)
+	}
+
+	dc := &osappsv1.DeploymentConfig{
+		ObjectMeta: metav1.ObjectMeta{Name: "syndesis-ui", Namespace: "fuse"},
+		Spec:       osappsv1.DeploymentConfigSpec{Replicas: 3},
+	}
+	ctx := &TestingContext{Client: fakeclient.NewFakeClientWithScheme(scheme, dc)}
+
+	disruption := &ScaleDeploymentConfig{Name: "syndesis-ui", Namespace: "fuse", Replicas: 0}
+
+	if err := disruption.Apply(ctx); err != nil {
+		t.Fatalf("initial Apply failed: %v", err)
+	}
+	// Simulate RunAlertScenario's reassert ticker invoking Apply again while
+	// the DeploymentConfig is already scaled to 0.
+	if err := disruption.Apply(ctx); err != nil {
+		t.Fatalf("reassert Apply failed: %v", err)
+	}
+
+	if err := disruption.Restore(ctx); err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+
+	got, err := getNumOfReplicasDeploymentConfig("syndesis-ui", "fuse", ctx.Client)
+	if err != nil {
+		t.Fatalf("failed to read back DeploymentConfig: %v", err)
+	}
+	if got != 3 {
+		t.Errorf("expected Restore to scale back to 3 replicas, got %d", got)
+	}
+}
+
+// TestBreakServiceReassertThenRestore guards against a regression where
+// re-invoking Apply after the service already carried the sabotage selector
+// clobbered the captured original selector, leaving Restore unable to
+// reinstate it.
+func TestBreakServiceReassertThenRestore(t *testing.T) {
+	originalSelector := map[string]string{"app": "apicast-production"}
+	svc := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "apicast-production", Namespace: "3scale"},
+		Spec:       corev1.ServiceSpec{Selector: originalSelector},
+	}
+	ctx := &TestingContext{Client: fakeclient.NewFakeClient(svc)}
+
+	disruption := &BreakService{Name: "apicast-production", Namespace: "3scale"}
+
+	if err := disruption.Apply(ctx); err != nil {
+		t.Fatalf("initial Apply failed: %v", err)
+	}
+	// Simulate RunAlertScenario's reassert ticker invoking Apply again while
+	// the service already carries the sabotage selector.
+	if err := disruption.Apply(ctx); err != nil {
+		t.Fatalf("reassert Apply failed: %v", err)
+	}
+
+	if err := disruption.Restore(ctx); err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+
+	got := &corev1.Service{}
+	key := k8sclient.ObjectKey{Name: "apicast-production", Namespace: "3scale"}
+	if err := ctx.Client.Get(goctx.TODO(), key, got); err != nil {
+		t.Fatalf("failed to read back service: %v", err)
+	}
+	if got.Spec.Selector["app"] != "apicast-production" {
+		t.Errorf("expected Restore to reinstate selector %v, got %v", originalSelector, got.Spec.Selector)
+	}
+}